@@ -1,8 +1,14 @@
 package command
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -12,6 +18,8 @@ import (
 	"time"
 
 	"github.com/mitchellh/cli"
+
+	"github.com/hashicorp/terraform/command/views"
 )
 
 // ServeCommand is a Command implementation that applies a Terraform
@@ -20,22 +28,46 @@ type ServeCommand struct {
 	Meta
 }
 
-func (c *ServeCommand) commands(w io.Writer) map[string]cli.CommandFactory {
+func (c *ServeCommand) commands(ctx context.Context, w io.Writer, jsonOutput bool, command string, overrides requestOverrides) (map[string]cli.CommandFactory, []string, error) {
 	meta := c.Meta
 	meta.oldUi = nil
-	meta.Ui = &cli.ConcurrentUi{
-		Ui: &ColorizeUi{
-			Colorize:   meta.Colorize(),
-			ErrorColor: "[red]",
-			WarnColor:  "[yellow]",
-			Ui: &cli.BasicUi{
-				Reader:      os.Stdin,
-				Writer:      w,
-				ErrorWriter: w,
+
+	if jsonOutput {
+		// Machine-readable callers get newline-delimited JSON events
+		// instead of colorized text; no point running those bytes
+		// through ColorizeUi.
+		meta.Ui = &cli.ConcurrentUi{
+			Ui: &views.JSONUi{
+				View:   views.NewJSON(w),
+				Reader: os.Stdin,
 			},
-		},
+		}
+	} else {
+		meta.Ui = &cli.ConcurrentUi{
+			Ui: &ColorizeUi{
+				Colorize:   meta.Colorize(),
+				ErrorColor: "[red]",
+				WarnColor:  "[yellow]",
+				Ui: &cli.BasicUi{
+					Reader:      os.Stdin,
+					Writer:      w,
+					ErrorWriter: w,
+				},
+			},
+		}
 	}
 
+	// Bridge the job's context into Meta's existing interrupt plumbing:
+	// closing ShutdownCh is how commands like apply already know to stop
+	// a running operation, so job cancellation reuses that rather than
+	// threading ctx through every command.
+	shutdownCh := make(chan struct{})
+	meta.ShutdownCh = shutdownCh
+	go func() {
+		<-ctx.Done()
+		close(shutdownCh)
+	}()
+
 	cmds := map[string]cli.CommandFactory{
 		"apply": func() (cli.Command, error) {
 			return &ApplyCommand{
@@ -305,33 +337,92 @@ func (c *ServeCommand) commands(w io.Writer) map[string]cli.CommandFactory {
 			}, nil
 		},
 	}
-	return cmds
+	return cmds, overrides.commandArgs(command), nil
 }
 
 func (c *ServeCommand) Run(args []string) int {
 	var port int
+	var tlsCert, tlsKey, tlsClientCA string
+	var authTokensFile, auditLogPath string
 	args, err := c.Meta.process(args, true)
 	if err != nil {
 		return 1
 	}
 
+	// Served commands never have a human watching a terminal, so
+	// suppress interactive prompts and CLI-oriented hints the same way
+	// a CI pipeline invoking `terraform` directly would. This is safe
+	// to set once for the whole process, unlike the per-request
+	// overrides below, since its value never varies between requests.
+	os.Setenv("TF_IN_AUTOMATION", "1")
+
 	cmdName := "apply"
 
 	cmdFlags := c.Meta.extendedFlagSet(cmdName)
 	cmdFlags.IntVar(&port, "port", 8080, "listen")
+	cmdFlags.StringVar(&tlsCert, "tls-cert", "", "path to a TLS certificate; enables HTTPS")
+	cmdFlags.StringVar(&tlsKey, "tls-key", "", "path to the TLS certificate's private key")
+	cmdFlags.StringVar(&tlsClientCA, "tls-client-ca", "", "path to a CA bundle; enables mTLS client verification")
+	cmdFlags.StringVar(&authTokensFile, "auth-tokens-file", "", "path to a JSON file of accepted bearer/HMAC tokens")
+	cmdFlags.StringVar(&auditLogPath, "audit-log", "", "path to append audit log entries to; defaults to stderr")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	jobs, err := NewJobManager(c.Meta.DataDir())
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing job store: %s", err))
+		return 1
+	}
+
+	auth, err := LoadAuthConfig(authTokensFile)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error loading auth tokens: %s", err))
+		return 1
+	}
+
+	auditSink := io.Writer(os.Stderr)
+	if auditLogPath != "" {
+		auditFile, err := os.OpenFile(auditLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error opening audit log: %s", err))
+			return 1
+		}
+		defer auditFile.Close()
+		auditSink = auditFile
+	}
+
+	if tlsClientCA != "" && (tlsCert == "" || tlsKey == "") {
+		c.Ui.Error("-tls-client-ca requires -tls-cert and -tls-key; mTLS cannot be configured without a server certificate")
+		return 1
+	}
+
+	tlsConfig, err := serveTLSConfig(tlsClientCA)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error configuring TLS: %s", err))
+		return 1
+	}
+
 	server := &http.Server{
 		Addr: ":" + strconv.Itoa(port),
 		Handler: &handler{
 			ServeCommand: c,
+			jobs:         jobs,
+			locks:        NewWorkspaceLocker(),
+			auth:         auth,
+			audit:        NewAuditLogger(auditSink),
 		},
+		TLSConfig: tlsConfig,
 	}
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
+		var err error
+		if tlsCert != "" && tlsKey != "" {
+			err = server.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Printf(err.Error())
 		}
 	}()
@@ -353,17 +444,143 @@ func (c *ServeCommand) Run(args []string) int {
 	return 0
 }
 
+// serveTLSConfig builds the *tls.Config used for mTLS client
+// verification when -tls-client-ca is set, or nil otherwise (plain
+// TLS, configured via ListenAndServeTLS's cert/key pair, needs no
+// extra config).
+func serveTLSConfig(clientCAPath string) (*tls.Config, error) {
+	if clientCAPath == "" {
+		return nil, nil
+	}
+
+	caCert, err := ioutil.ReadFile(clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading TLS client CA: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAPath)
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
 type handler struct {
 	*ServeCommand
+	jobs  *JobManager
+	locks *WorkspaceLocker
+	auth  *AuthConfig
+	audit *AuditLogger
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	var caller *Token
+	if h.auth != nil {
+		token, err := h.auth.Authenticate(r, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		caller = token
+	}
+
+	switch {
+	case r.URL.Path == "/v1/jobs" && r.Method == http.MethodPost:
+		h.handleJobCreate(w, r, caller)
+	case r.URL.Path == "/v1/jobs" && r.Method == http.MethodGet:
+		h.handleJobList(w, r, caller)
+	case strings.HasPrefix(r.URL.Path, "/v1/jobs/") && strings.HasSuffix(r.URL.Path, "/logs"):
+		h.handleJobLogs(w, r, caller)
+	case strings.HasPrefix(r.URL.Path, "/v1/jobs/") && r.Method == http.MethodGet:
+		h.handleJobGet(w, r, caller)
+	case strings.HasPrefix(r.URL.Path, "/v1/jobs/") && r.Method == http.MethodDelete:
+		h.handleJobCancel(w, r, caller)
+	default:
+		h.serveSync(w, r, caller)
+	}
+}
+
+// jobCallerAllowed reports whether caller is permitted to act on job,
+// using the same ACL that governed the command that created it. A nil
+// caller means authentication is disabled.
+func jobCallerAllowed(caller *Token, job *Job) bool {
+	return caller == nil || caller.allows(job.Command, job.Workspace)
+}
+
+// serveSync preserves the original synchronous behavior: it runs the
+// requested command to completion and streams its combined output
+// directly back on the HTTP response. Long-running commands like
+// plan/apply should instead go through POST /v1/jobs.
+func (h *handler) serveSync(w http.ResponseWriter, r *http.Request, caller *Token) {
+	start := time.Now()
 	cmd_args, _ := r.URL.Query()["args"]
 	log.Printf("[INFO] CLI command args: %#v", cmd_args)
 
+	command := ""
+	if len(cmd_args) > 0 {
+		command = cmd_args[0]
+	}
+	workspace := normalizeWorkspace(r.URL.Query().Get("workspace"))
+	overrides := overridesFromQuery(r.URL.Query())
+
+	if caller != nil && !caller.allows(command, workspace) {
+		http.Error(w, fmt.Sprintf("token %q is not permitted to run %q on workspace %q", caller.Name, command, workspace), http.StatusForbidden)
+		return
+	}
+
+	// Nested subcommands such as "state rm" arrive as two args, so check
+	// the joined form as well as the first arg alone.
+	if isMutatingCommand(command) || (len(cmd_args) > 1 && isMutatingCommand(cmd_args[0]+" "+cmd_args[1])) {
+		workingDir := lockWorkingDir(h.ServeCommand.servedWorkingDir(), overrides.Chdir)
+		holderID := fmt.Sprintf("sync:%s:%d", r.RemoteAddr, start.UnixNano())
+		holder, ok := h.locks.TryLock(workingDir, workspace, holderID)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(struct {
+				Error  string               `json:"error"`
+				Holder *WorkspaceLockHolder `json:"holder"`
+			}{
+				Error:  fmt.Sprintf("workspace %q is locked by job %s", workspace, holder.JobID),
+				Holder: holder,
+			})
+			return
+		}
+		defer h.locks.Unlock(workingDir, workspace)
+	}
+
+	jsonOutput := wantsJSON(r)
+	if jsonOutput {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	restoreOverrides, err := scopeOverrides(overrides)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer restoreOverrides()
+
+	cmds, extra, err := h.ServeCommand.commands(r.Context(), w, jsonOutput, command, overrides)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	cliRunner := &cli.CLI{
-		Args:       cmd_args,
-		Commands:   h.ServeCommand.commands(w),
+		Args:       append(append([]string{}, cmd_args...), extra...),
+		Commands:   cmds,
 		HelpWriter: w,
 	}
 
@@ -373,6 +590,276 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			err.Error(),
 			exitCode)
 	}
+	if jsonOutput {
+		views.NewJSON(w).Result(exitCode)
+	}
+
+	var auditArgs []string
+	if len(cmd_args) > 1 {
+		auditArgs = cmd_args[1:]
+	}
+	h.audit.Log(AuditEntry{
+		Time:       start,
+		Caller:     callerName(caller),
+		RemoteAddr: r.RemoteAddr,
+		Command:    command,
+		Args:       auditArgs,
+		Workspace:  workspace,
+		ExitCode:   exitCode,
+		Duration:   time.Since(start).String(),
+	})
+}
+
+// callerName returns a token's name for audit logging, or "" when the
+// serve instance has authentication disabled.
+func callerName(caller *Token) string {
+	if caller == nil {
+		return ""
+	}
+	return caller.Name
+}
+
+// wantsJSON reports whether a request opted into the newline-delimited
+// JSON output mode, either via the Accept header or an ?output=json
+// query parameter.
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("output") == "json" {
+		return true
+	}
+	for _, accept := range r.Header["Accept"] {
+		if strings.Contains(accept, "application/x-ndjson") {
+			return true
+		}
+	}
+	return false
+}
+
+// jobCreateRequest is the POST /v1/jobs request body.
+type jobCreateRequest struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Workspace   string            `json:"workspace,omitempty"`
+	Vars        map[string]string `json:"vars,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Chdir       string            `json:"chdir,omitempty"`
+	Parallelism int               `json:"parallelism,omitempty"`
+	Output      string            `json:"output,omitempty"`
+}
+
+func (h *handler) handleJobCreate(w http.ResponseWriter, r *http.Request, caller *Token) {
+	var req jobCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decoding request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	if req.Command == "" {
+		http.Error(w, "command is required", http.StatusBadRequest)
+		return
+	}
+
+	workspace := normalizeWorkspace(req.Workspace)
+
+	if caller != nil && !caller.allows(req.Command, workspace) {
+		http.Error(w, fmt.Sprintf("token %q is not permitted to run %q on workspace %q", caller.Name, req.Command, workspace), http.StatusForbidden)
+		return
+	}
+
+	workingDir := lockWorkingDir(h.ServeCommand.servedWorkingDir(), req.Chdir)
+
+	job, err := h.jobs.Create(req.Command, req.Args, workspace, req.Vars, req.Output)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job.Caller = callerName(caller)
+	job.RemoteAddr = r.RemoteAddr
+	job.Env = req.Env
+	job.Chdir = req.Chdir
+	job.Parallelism = req.Parallelism
+	h.jobs.save(job)
+
+	if isMutatingCommand(req.Command) {
+		holder, ok := h.locks.TryLock(workingDir, workspace, job.ID)
+		if !ok {
+			jobs := h.jobs
+			jobs.finish(job, 1, fmt.Errorf("workspace %q is locked by job %s", workspace, holder.JobID))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(struct {
+				Error  string               `json:"error"`
+				Holder *WorkspaceLockHolder `json:"holder"`
+			}{
+				Error:  fmt.Sprintf("workspace %q is locked by job %s", workspace, holder.JobID),
+				Holder: holder,
+			})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.jobs.SetCancel(job, cancel)
+	go h.ServeCommand.runJob(ctx, cancel, h.jobs, h.locks, h.audit, workingDir, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// servedWorkingDir returns the working directory that served commands
+// operate against. It's the key, alongside workspace, used to
+// serialize mutating commands via WorkspaceLocker.
+func (c *ServeCommand) servedWorkingDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
+
+func (h *handler) handleJobList(w http.ResponseWriter, r *http.Request, caller *Token) {
+	status := JobStatus(r.URL.Query().Get("status"))
+
+	all := h.jobs.List(status)
+	visible := make([]*Job, 0, len(all))
+	for _, job := range all {
+		if jobCallerAllowed(caller, job) {
+			visible = append(visible, job)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+func (h *handler) handleJobGet(w http.ResponseWriter, r *http.Request, caller *Token) {
+	id := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
+	job := h.jobs.Get(id)
+	if job == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if !jobCallerAllowed(caller, job) {
+		http.Error(w, fmt.Sprintf("token %q is not permitted to access job %s", caller.Name, id), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *handler) handleJobCancel(w http.ResponseWriter, r *http.Request, caller *Token) {
+	id := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
+	job := h.jobs.Get(id)
+	if job == nil {
+		http.Error(w, "job not found or already finished", http.StatusNotFound)
+		return
+	}
+	if !jobCallerAllowed(caller, job) {
+		http.Error(w, fmt.Sprintf("token %q is not permitted to cancel job %s", caller.Name, id), http.StatusForbidden)
+		return
+	}
+	if !h.jobs.Cancel(id) {
+		http.Error(w, "job not found or already finished", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleJobLogs streams a job's log file back to the caller, starting
+// at the byte offset given by ?since=, optionally following new output
+// as it's appended while the job is still running (?follow=true).
+func (h *handler) handleJobLogs(w http.ResponseWriter, r *http.Request, caller *Token) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/jobs/"), "/logs")
+	job := h.jobs.Get(id)
+	if job == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if !jobCallerAllowed(caller, job) {
+		http.Error(w, fmt.Sprintf("token %q is not permitted to access job %s", caller.Name, id), http.StatusForbidden)
+		return
+	}
+
+	var since int64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since offset", http.StatusBadRequest)
+			return
+		}
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+
+	var f *os.File
+	for {
+		var err error
+		f, err = os.Open(h.jobs.logPath(id))
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("opening job log: %s", err), http.StatusInternalServerError)
+			return
+		}
+		// The job is still queued: runJob hasn't opened its log file
+		// yet. Treat that the same as an empty log rather than a
+		// failure, waiting for it to appear when the caller asked to
+		// follow. A job can also reach a terminal state without ever
+		// creating a log file (e.g. it was rejected by the workspace
+		// lock before runJob was spawned), so check status on every
+		// iteration rather than waiting for open() to succeed forever.
+		if !follow {
+			return
+		}
+		if current := h.jobs.Get(id); current == nil || current.Status == JobSucceeded || current.Status == JobFailed {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(since, io.SeekStart); err != nil {
+		http.Error(w, fmt.Sprintf("seeking job log: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	flusher, canFlush := w.(http.Flusher)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			job := h.jobs.Get(id)
+			if !follow || job == nil || job.Status == JobSucceeded || job.Status == JobFailed {
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("[ERROR] serve: reading job log %s: %s", id, err)
+			return
+		}
+	}
 }
 
 func (c *ServeCommand) Help() string {
@@ -0,0 +1,125 @@
+package command
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Token describes one caller's credentials and the commands/workspaces
+// they're permitted to invoke through the serve API. A "*" entry in
+// Commands or Workspaces matches anything.
+type Token struct {
+	Name       string   `json:"name"`
+	Value      string   `json:"token,omitempty"`
+	HMACSecret string   `json:"hmac_secret,omitempty"`
+	Commands   []string `json:"commands"`
+	Workspaces []string `json:"workspaces"`
+}
+
+// allows reports whether this token may invoke the given served
+// command against the given workspace.
+func (t *Token) allows(command, workspace string) bool {
+	return matchesACL(t.Commands, command) && matchesACL(t.Workspaces, workspace)
+}
+
+func matchesACL(allowed []string, value string) bool {
+	for _, a := range allowed {
+		if a == "*" || a == value {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthConfig is the set of tokens a served instance will accept,
+// loaded once at startup from a JSON file. A nil *AuthConfig means
+// authentication is disabled, which matches the historical (insecure)
+// default of serve.
+type AuthConfig struct {
+	byValue map[string]*Token
+	byName  map[string]*Token
+}
+
+// LoadAuthConfig reads a JSON array of tokens from path (falling back
+// to the TF_SERVE_TOKENS_FILE environment variable when path is
+// empty). It returns a nil config, with no error, when neither is set
+// so callers can run unauthenticated for local development.
+func LoadAuthConfig(path string) (*AuthConfig, error) {
+	if path == "" {
+		path = os.Getenv("TF_SERVE_TOKENS_FILE")
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading auth tokens file: %s", err)
+	}
+
+	var tokens []*Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parsing auth tokens file: %s", err)
+	}
+
+	cfg := &AuthConfig{
+		byValue: make(map[string]*Token),
+		byName:  make(map[string]*Token),
+	}
+	for _, t := range tokens {
+		if t.Name == "" {
+			return nil, fmt.Errorf("a token in %s is missing its name", path)
+		}
+		if t.Value == "" && t.HMACSecret == "" {
+			return nil, fmt.Errorf("token %q needs either a bearer value or an hmac_secret", t.Name)
+		}
+		if t.Value != "" {
+			cfg.byValue[t.Value] = t
+		}
+		cfg.byName[t.Name] = t
+	}
+	return cfg, nil
+}
+
+// Authenticate identifies the caller of r, either from a bearer token
+// in the Authorization header or from an HMAC-SHA256 signature over
+// the request body in the X-Signature header (paired with a token
+// name in X-Token-Name). body must be the full, already-read request
+// body, since the signing covers it.
+func (cfg *AuthConfig) Authenticate(r *http.Request, body []byte) (*Token, error) {
+	if sig := r.Header.Get("X-Signature"); sig != "" {
+		name := r.Header.Get("X-Token-Name")
+		token, ok := cfg.byName[name]
+		if !ok || token.HMACSecret == "" {
+			return nil, fmt.Errorf("unknown signing token %q", name)
+		}
+
+		mac := hmac.New(sha256.New, []byte(token.HMACSecret))
+		mac.Write(body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(sig)) != 1 {
+			return nil, fmt.Errorf("invalid signature for token %q", name)
+		}
+		return token, nil
+	}
+
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+
+	token, ok := cfg.byValue[strings.TrimPrefix(auth, prefix)]
+	if !ok {
+		return nil, fmt.Errorf("invalid bearer token")
+	}
+	return token, nil
+}
@@ -0,0 +1,255 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// JobStatus is the lifecycle state of an asynchronous serve job.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a single asynchronous invocation of a CLI command submitted
+// through the serve HTTP API. It is the unit persisted to disk so that
+// a server restart doesn't lose track of in-flight or completed work.
+type Job struct {
+	ID        string            `json:"id"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args"`
+	Workspace string            `json:"workspace,omitempty"`
+	Vars      map[string]string `json:"vars,omitempty"`
+	// Env is never serialized: per chunk0-5 it may carry provider
+	// credentials, and Job is both returned on the wire (GET/LIST
+	// /v1/jobs) and persisted in plaintext to record.json, neither of
+	// which should leak another caller's secrets.
+	Env         map[string]string `json:"-"`
+	Chdir       string            `json:"chdir,omitempty"`
+	Parallelism int               `json:"parallelism,omitempty"`
+	Output      string            `json:"output,omitempty"`
+	Caller      string            `json:"caller,omitempty"`
+	RemoteAddr  string            `json:"remote_addr,omitempty"`
+	Status      JobStatus         `json:"status"`
+	ExitCode    int               `json:"exit_code"`
+	Err         string            `json:"error,omitempty"`
+	StartTime   time.Time         `json:"start_time,omitempty"`
+	EndTime     time.Time         `json:"end_time,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// jobRecordFile and jobLogFile are the on-disk names used within each
+// job's directory under the job store root.
+const (
+	jobRecordFile = "record.json"
+	jobLogFile    = "log.txt"
+)
+
+// JobManager tracks the async jobs submitted to a ServeCommand and
+// persists their state under the data dir so a restart of the serve
+// process doesn't lose in-flight or historical job records.
+type JobManager struct {
+	mu   sync.RWMutex
+	dir  string
+	jobs map[string]*Job
+}
+
+// NewJobManager creates a JobManager rooted at <dataDir>/serve/jobs,
+// reloading any job records left over from a previous process.
+func NewJobManager(dataDir string) (*JobManager, error) {
+	dir := filepath.Join(dataDir, "serve", "jobs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating job store at %s: %s", dir, err)
+	}
+
+	jm := &JobManager{
+		dir:  dir,
+		jobs: make(map[string]*Job),
+	}
+	if err := jm.reload(); err != nil {
+		return nil, err
+	}
+	return jm, nil
+}
+
+// reload populates jm.jobs from any job directories already present on
+// disk. Jobs that were still "running" when the process exited are
+// marked "failed", since their goroutine is gone and can't finish them.
+func (jm *JobManager) reload() error {
+	entries, err := ioutil.ReadDir(jm.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(jm.dir, entry.Name(), jobRecordFile))
+		if err != nil {
+			log.Printf("[WARN] serve: skipping unreadable job record %s: %s", entry.Name(), err)
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Printf("[WARN] serve: skipping corrupt job record %s: %s", entry.Name(), err)
+			continue
+		}
+
+		if job.Status == JobQueued || job.Status == JobRunning {
+			job.Status = JobFailed
+			job.Err = "serve process restarted while job was in flight"
+			job.EndTime = time.Now()
+		}
+
+		jm.jobs[job.ID] = &job
+		jm.save(&job)
+	}
+
+	return nil
+}
+
+// Create registers a new queued job and creates its on-disk directory.
+func (jm *JobManager) Create(command string, args []string, workspace string, vars map[string]string, output string) (*Job, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("generating job id: %s", err)
+	}
+
+	if err := os.MkdirAll(jm.jobDir(id), 0755); err != nil {
+		return nil, fmt.Errorf("creating job dir: %s", err)
+	}
+
+	job := &Job{
+		ID:        id,
+		Command:   command,
+		Args:      args,
+		Workspace: workspace,
+		Vars:      vars,
+		Output:    output,
+		Status:    JobQueued,
+	}
+
+	jm.mu.Lock()
+	jm.jobs[id] = job
+	jm.mu.Unlock()
+
+	jm.save(job)
+	return job, nil
+}
+
+// SetCancel records the context.CancelFunc that stops a job's
+// in-flight command. It's called synchronously, before the job's
+// goroutine is spawned, so that a cancel or status request arriving
+// immediately after Create always sees a non-nil cancel func rather
+// than racing runJob's own setup.
+func (jm *JobManager) SetCancel(job *Job, cancel context.CancelFunc) {
+	jm.mu.Lock()
+	job.cancel = cancel
+	jm.mu.Unlock()
+}
+
+// Get returns the job with the given id, or nil if it isn't known.
+func (jm *JobManager) Get(id string) *Job {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	return jm.jobs[id]
+}
+
+// List returns all known jobs, optionally filtered by status.
+func (jm *JobManager) List(status JobStatus) []*Job {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(jm.jobs))
+	for _, job := range jm.jobs {
+		if status != "" && job.Status != status {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// Cancel requests that a running job stop via its context. It returns
+// false if the job is unknown or already finished.
+func (jm *JobManager) Cancel(id string) bool {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, ok := jm.jobs[id]
+	if !ok || job.cancel == nil || job.Status == JobSucceeded || job.Status == JobFailed {
+		return false
+	}
+	job.cancel()
+	return true
+}
+
+// jobDir returns the on-disk directory for a job's record and log.
+func (jm *JobManager) jobDir(id string) string {
+	return filepath.Join(jm.dir, id)
+}
+
+// logPath returns the path to a job's append-only log file.
+func (jm *JobManager) logPath(id string) string {
+	return filepath.Join(jm.jobDir(id), jobLogFile)
+}
+
+// save persists the current state of a job record to disk.
+func (jm *JobManager) save(job *Job) {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		log.Printf("[ERROR] serve: marshaling job %s: %s", job.ID, err)
+		return
+	}
+
+	path := filepath.Join(jm.jobDir(job.ID), jobRecordFile)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		log.Printf("[ERROR] serve: persisting job %s: %s", job.ID, err)
+	}
+}
+
+// markRunning transitions a job to running and records its start time,
+// then persists the change. The job's cancel func is set earlier, by
+// SetCancel, so a caller that cancels or inspects the job before it
+// starts running still observes it correctly.
+func (jm *JobManager) markRunning(job *Job) {
+	jm.mu.Lock()
+	job.Status = JobRunning
+	job.StartTime = time.Now()
+	jm.mu.Unlock()
+	jm.save(job)
+}
+
+// finish transitions a job to its terminal status and persists it.
+func (jm *JobManager) finish(job *Job, exitCode int, err error) {
+	jm.mu.Lock()
+	job.ExitCode = exitCode
+	job.EndTime = time.Now()
+	if err != nil {
+		job.Status = JobFailed
+		job.Err = err.Error()
+	} else if exitCode != 0 {
+		job.Status = JobFailed
+	} else {
+		job.Status = JobSucceeded
+	}
+	jm.mu.Unlock()
+	jm.save(job)
+}
@@ -0,0 +1,81 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/hashicorp/terraform/command/views"
+)
+
+// runJob executes a job's underlying CLI command in the background,
+// writing its combined output to the job's log file and recording the
+// final status once the command returns. It's launched as a goroutine
+// by the handler immediately after the job is created. ctx and cancel
+// are created by the caller (before the goroutine is spawned) so that
+// a cancel or status request racing the start of this goroutine always
+// sees a job with a usable cancel func; runJob guarantees cancel is
+// eventually called, so its context is never leaked.
+func (c *ServeCommand) runJob(ctx context.Context, cancel context.CancelFunc, jobs *JobManager, locks *WorkspaceLocker, audit *AuditLogger, workingDir string, job *Job) {
+	defer cancel()
+	if isMutatingCommand(job.Command) {
+		defer locks.Unlock(workingDir, job.Workspace)
+	}
+	defer func() {
+		audit.Log(AuditEntry{
+			Time:       job.EndTime,
+			Caller:     job.Caller,
+			RemoteAddr: job.RemoteAddr,
+			Command:    job.Command,
+			Args:       job.Args,
+			Workspace:  job.Workspace,
+			ExitCode:   job.ExitCode,
+			Duration:   job.EndTime.Sub(job.StartTime).String(),
+		})
+	}()
+
+	logFile, err := os.OpenFile(jobs.logPath(job.ID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		jobs.finish(job, 1, fmt.Errorf("opening job log: %s", err))
+		return
+	}
+	defer logFile.Close()
+
+	jobs.markRunning(job)
+
+	jsonOutput := job.Output == "json"
+	overrides := requestOverrides{
+		Vars:        job.Vars,
+		Env:         job.Env,
+		Chdir:       job.Chdir,
+		Workspace:   job.Workspace,
+		Parallelism: job.Parallelism,
+	}
+
+	restoreOverrides, err := scopeOverrides(overrides)
+	if err != nil {
+		jobs.finish(job, 1, err)
+		return
+	}
+	defer restoreOverrides()
+
+	cmds, extra, err := c.commands(ctx, logFile, jsonOutput, job.Command, overrides)
+	if err != nil {
+		jobs.finish(job, 1, err)
+		return
+	}
+
+	cliRunner := &cli.CLI{
+		Args:       append(append([]string{job.Command}, job.Args...), extra...),
+		Commands:   cmds,
+		HelpWriter: logFile,
+	}
+
+	exitCode, err := cliRunner.Run()
+	if jsonOutput {
+		views.NewJSON(logFile).Result(exitCode)
+	}
+	jobs.finish(job, exitCode, err)
+}
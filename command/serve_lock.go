@@ -0,0 +1,112 @@
+package command
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// normalizeWorkspace returns the canonical form of a requested
+// workspace name, treating "" the same as the default workspace. Every
+// caller that builds a workspace lock key (or checks a token's ACL)
+// must normalize first, or a sync request and a job request that both
+// target the default workspace end up keyed differently and never
+// exclude each other.
+func normalizeWorkspace(workspace string) string {
+	if workspace == "" {
+		return "default"
+	}
+	return workspace
+}
+
+// lockWorkingDir resolves the directory a served command will actually
+// run against, applying a chdir override (relative to base, or taken
+// as-is if already absolute) the same way os.Chdir would. Without this,
+// a lock keyed on the server's own working directory wouldn't reflect
+// where an overridden command actually executes.
+func lockWorkingDir(base, chdir string) string {
+	if chdir == "" {
+		return base
+	}
+	if filepath.IsAbs(chdir) {
+		return filepath.Clean(chdir)
+	}
+	return filepath.Join(base, chdir)
+}
+
+// mutatingCommands are the served subcommands that change state and so
+// must be serialized per (working dir, workspace) to avoid two callers
+// racing on the same state file or backend lock. Read-only commands
+// like plan/show/validate are left out so they can run concurrently.
+var mutatingCommands = map[string]bool{
+	"apply":        true,
+	"destroy":      true,
+	"import":       true,
+	"taint":        true,
+	"untaint":      true,
+	"state mv":     true,
+	"state rm":     true,
+	"state push":   true,
+	"force-unlock": true,
+}
+
+// isMutatingCommand reports whether the given served command (as
+// submitted to POST /v1/jobs) changes state and therefore needs
+// exclusive access to its workspace.
+func isMutatingCommand(command string) bool {
+	return mutatingCommands[command]
+}
+
+// workspaceLockKey identifies the resource a mutating command needs
+// exclusive access to.
+type workspaceLockKey struct {
+	workingDir string
+	workspace  string
+}
+
+// WorkspaceLockHolder describes who currently holds a workspace lock,
+// returned to conflicting callers so they can decide whether to wait.
+type WorkspaceLockHolder struct {
+	JobID     string    `json:"job_id"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// WorkspaceLocker serializes state-mutating served commands against the
+// same (working dir, workspace) pair. It does not replace the backend's
+// own state lock; it exists so a conflicting caller gets a fast, useful
+// 409 instead of racing another request to acquire that lock.
+type WorkspaceLocker struct {
+	mu      sync.Mutex
+	holders map[workspaceLockKey]*WorkspaceLockHolder
+}
+
+// NewWorkspaceLocker creates an empty WorkspaceLocker.
+func NewWorkspaceLocker() *WorkspaceLocker {
+	return &WorkspaceLocker{holders: make(map[workspaceLockKey]*WorkspaceLockHolder)}
+}
+
+// TryLock attempts to acquire exclusive access to (workingDir,
+// workspace) for jobID. If the workspace is already locked, it returns
+// the existing holder and ok=false.
+func (l *WorkspaceLocker) TryLock(workingDir, workspace, jobID string) (holder *WorkspaceLockHolder, ok bool) {
+	key := workspaceLockKey{workingDir: workingDir, workspace: workspace}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if existing, busy := l.holders[key]; busy {
+		return existing, false
+	}
+
+	l.holders[key] = &WorkspaceLockHolder{JobID: jobID, StartTime: time.Now()}
+	return nil, true
+}
+
+// Unlock releases the lock on (workingDir, workspace), if any is held.
+func (l *WorkspaceLocker) Unlock(workingDir, workspace string) {
+	key := workspaceLockKey{workingDir: workingDir, workspace: workspace}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.holders, key)
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// requestOverrides are the per-HTTP-call customizations a served
+// command can receive, mirroring what a normal `terraform` invocation
+// gets from its shell environment, working directory, and command-line
+// flags. Since served commands run in-process rather than as
+// subprocesses, applying them is split in two: scopeOverrides applies
+// Env, Workspace, and Chdir to the process itself for the duration of
+// one invocation, while commandArgs translates Vars and Parallelism
+// into flags for the specific command being run.
+type requestOverrides struct {
+	Vars        map[string]string `json:"vars,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Chdir       string            `json:"chdir,omitempty"`
+	Workspace   string            `json:"workspace,omitempty"`
+	Parallelism int               `json:"parallelism,omitempty"`
+}
+
+// overridesFromQuery builds requestOverrides from a sync request's
+// query string: repeated ?var=key=value, ?chdir=, ?workspace=, and
+// ?parallelism=.
+func overridesFromQuery(values map[string][]string) requestOverrides {
+	overrides := requestOverrides{
+		Chdir:     first(values["chdir"]),
+		Workspace: first(values["workspace"]),
+	}
+
+	if vars := values["var"]; len(vars) > 0 {
+		overrides.Vars = make(map[string]string)
+		for _, kv := range vars {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			overrides.Vars[parts[0]] = parts[1]
+		}
+	}
+
+	if p := first(values["parallelism"]); p != "" {
+		if n, err := strconv.Atoi(p); err == nil {
+			overrides.Parallelism = n
+		}
+	}
+
+	return overrides
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// commandsAcceptingVars are the served commands that accept -var
+// flags, i.e. anything that evaluates the configuration.
+var commandsAcceptingVars = map[string]bool{
+	"apply":   true,
+	"console": true,
+	"destroy": true,
+	"import":  true,
+	"plan":    true,
+	"refresh": true,
+}
+
+// commandsAcceptingParallelism are the served commands that accept a
+// -parallelism flag, i.e. anything that walks the resource graph.
+var commandsAcceptingParallelism = map[string]bool{
+	"apply":   true,
+	"destroy": true,
+	"plan":    true,
+	"refresh": true,
+}
+
+// commandArgs translates o's Vars and Parallelism into flags for the
+// given served command, omitting any flag that command doesn't accept
+// rather than passing it through and letting the command's flag parser
+// reject it. TF_VAR_*-prefixed entries of Env need no translation
+// here: scopeOverrides sets them as real environment variables, which
+// Terraform already reads variable values from directly.
+func (o requestOverrides) commandArgs(command string) []string {
+	var args []string
+
+	if commandsAcceptingVars[command] {
+		for k, v := range o.Vars {
+			args = append(args, fmt.Sprintf("-var=%s=%s", k, v))
+		}
+	}
+	if o.Parallelism > 0 && commandsAcceptingParallelism[command] {
+		args = append(args, fmt.Sprintf("-parallelism=%d", o.Parallelism))
+	}
+
+	return args
+}
+
+// envMu serializes every served command invocation, not just ones that
+// set Env/Workspace/Chdir. Since served commands run as in-process
+// calls rather than subprocesses, os.Environ() and the working
+// directory are genuinely shared with every other request: an
+// overridden request's os.Chdir/os.Setenv stays in effect for as long
+// as its command runs, so any other request — including one with no
+// overrides of its own, like a concurrent plan or show — that happened
+// to run at the same time would silently execute against the wrong
+// directory, workspace, or variables. Holding envMu for the full
+// duration of every invocation, overridden or not, is the only way to
+// guarantee that without a cloned per-invocation Meta and a subprocess
+// boundary around command execution, neither of which this in-process
+// command-dispatch model has.
+var envMu sync.Mutex
+
+// scopeOverrides applies o's Env, Workspace, and Chdir to the process
+// for the duration of a single served command invocation, returning a
+// restore func that must be called once that invocation finishes
+// (success or failure) to release envMu and undo the changes. It must
+// be called, and its restore func deferred, around every served
+// command — including ones with no overrides — so envMu actually
+// serializes all of them; see envMu's comment for why. Workspace is
+// applied via the TF_WORKSPACE environment variable rather than
+// `terraform workspace select`, so it never touches the shared
+// .terraform/environment file a concurrent request might also be
+// reading or writing.
+func scopeOverrides(o requestOverrides) (restore func(), err error) {
+	envMu.Lock()
+
+	var undo []func()
+	unwind := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		envMu.Unlock()
+	}
+
+	for k, v := range o.Env {
+		undo = append(undo, setenv(k, v))
+	}
+	if o.Workspace != "" {
+		undo = append(undo, setenv("TF_WORKSPACE", o.Workspace))
+	}
+	if o.Chdir != "" {
+		prevDir, err := os.Getwd()
+		if err != nil {
+			unwind()
+			return nil, fmt.Errorf("getting working directory: %s", err)
+		}
+		if err := os.Chdir(o.Chdir); err != nil {
+			unwind()
+			return nil, fmt.Errorf("changing to directory %q: %s", o.Chdir, err)
+		}
+		undo = append(undo, func() { os.Chdir(prevDir) })
+	}
+
+	return unwind, nil
+}
+
+// setenv sets the environment variable k to v and returns a func that
+// restores whatever it was set to before (or unsets it, if it wasn't
+// previously set).
+func setenv(k, v string) func() {
+	prev, had := os.LookupEnv(k)
+	os.Setenv(k, v)
+	if had {
+		return func() { os.Setenv(k, prev) }
+	}
+	return func() { os.Unsetenv(k) }
+}
@@ -0,0 +1,131 @@
+// Package views provides machine-readable renderings of command output,
+// as an alternative to the human-oriented cli.Ui used by default. It is
+// intentionally small for now: a newline-delimited JSON encoder used by
+// `terraform serve`, analogous in spirit to the `-json` flag accepted by
+// plan/apply/validate.
+package views
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType identifies the shape of a JSON emitted on a JSON view stream.
+type EventType string
+
+const (
+	EventDiagnostic    EventType = "diagnostic"
+	EventPlannedChange EventType = "planned_change"
+	EventApplyProgress EventType = "apply_progress"
+	EventOutputs       EventType = "outputs"
+	EventResult        EventType = "result"
+)
+
+// Range identifies a location in configuration source, mirroring the
+// shape Terraform's diagnostics already use elsewhere.
+type Range struct {
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// Event is the envelope written for every line of a JSON view stream.
+// Only the fields relevant to Type are populated.
+type Event struct {
+	Type EventType `json:"type"`
+
+	// diagnostic
+	Severity string `json:"severity,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Range    *Range `json:"range,omitempty"`
+
+	// planned_change
+	Resource string      `json:"resource,omitempty"`
+	Action   string      `json:"action,omitempty"`
+	Before   interface{} `json:"before,omitempty"`
+	After    interface{} `json:"after,omitempty"`
+
+	// apply_progress
+	Elapsed string `json:"elapsed,omitempty"`
+
+	// outputs
+	Values map[string]interface{} `json:"values,omitempty"`
+
+	// result
+	ExitCode *int `json:"exit_code,omitempty"`
+}
+
+// JSON is a newline-delimited JSON writer for command events. It's safe
+// for concurrent use, since a served command's Ui may be called from
+// more than one goroutine during a single invocation.
+type JSON struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSON returns a JSON view that writes one event per line to w.
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{enc: json.NewEncoder(w)}
+}
+
+func (v *JSON) emit(e Event) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// Encoding errors here mean the underlying writer (an HTTP response
+	// or job log file) is gone; there's nothing more useful to do than
+	// drop the event, same as a human-oriented Ui losing its terminal.
+	_ = v.enc.Encode(e)
+}
+
+// Diagnostic emits a {type: "diagnostic"} event.
+func (v *JSON) Diagnostic(severity, summary, detail string, rng *Range) {
+	v.emit(Event{
+		Type:     EventDiagnostic,
+		Severity: severity,
+		Summary:  summary,
+		Detail:   detail,
+		Range:    rng,
+	})
+}
+
+// PlannedChange emits a {type: "planned_change"} event describing a
+// single resource action from a plan.
+func (v *JSON) PlannedChange(resource, action string, before, after interface{}) {
+	v.emit(Event{
+		Type:     EventPlannedChange,
+		Resource: resource,
+		Action:   action,
+		Before:   before,
+		After:    after,
+	})
+}
+
+// ApplyProgress emits a {type: "apply_progress"} event for a resource
+// currently being applied.
+func (v *JSON) ApplyProgress(resource string, elapsed time.Duration) {
+	v.emit(Event{
+		Type:     EventApplyProgress,
+		Resource: resource,
+		Elapsed:  elapsed.Round(time.Second).String(),
+	})
+}
+
+// Outputs emits a {type: "outputs"} event with the final output values.
+func (v *JSON) Outputs(values map[string]interface{}) {
+	v.emit(Event{
+		Type:   EventOutputs,
+		Values: values,
+	})
+}
+
+// Result emits the terminating {type: "result"} event. Callers should
+// emit exactly one of these as the last event on a stream.
+func (v *JSON) Result(exitCode int) {
+	v.emit(Event{
+		Type:     EventResult,
+		ExitCode: &exitCode,
+	})
+}
@@ -0,0 +1,248 @@
+package views
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// JSONUi adapts a JSON view to the cli.Ui interface so it can be used
+// as a drop-in Ui for commands that don't yet know how to talk to a
+// view directly. Terraform at this version doesn't expose plan/apply's
+// structured data (a *plans.Changes, a terraform.Hook) anywhere Meta
+// or a served command can reach it, so JSONUi can only work from the
+// same rendered text a human-oriented Ui would print. It recognizes a
+// handful of well-known lines — a resource's planned action and its
+// attribute diff, apply progress, and the final "Outputs:" block — and
+// re-emits those as the richer planned_change, apply_progress, and
+// outputs event types instead of a generic diagnostic. This is
+// necessarily best-effort: it tracks real terraform/internal output
+// formatting rather than a stable machine-readable contract, and
+// should be replaced with a genuine hook or structured plan/apply view
+// if one becomes available to this package.
+type JSONUi struct {
+	View   *JSON
+	Reader io.Reader
+
+	inOutputs bool
+	outputs   map[string]interface{}
+
+	change *pendingChange
+}
+
+// pendingChange accumulates a resource's attribute diff between its
+// "# resource will be X" header line and the closing brace of its
+// diff body, so the eventual planned_change event carries real before/
+// after values instead of none.
+type pendingChange struct {
+	resource      string
+	action        string
+	before, after map[string]interface{}
+	depth         int
+}
+
+var _ cli.Ui = (*JSONUi)(nil)
+
+// ansiEscape strips terminal color/style codes, so a colorized Ui
+// sharing this text stream (or a future caller that forgets to
+// suppress colorization for JSON mode) doesn't break line matching.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// plannedChangeLine matches the "  # aws_instance.example will be
+// created" summary line plan/apply print above each resource diff.
+var plannedChangeLine = regexp.MustCompile(`^#\s+(\S+)\s+will be (created|updated in-place|destroyed|replaced|read during apply)`)
+
+// attrChangeLine matches a single changed-attribute line inside a
+// resource's diff body, e.g. `~ ami = "ami-old" -> "ami-new"` or
+// `+ tags.owner = "platform"`.
+var attrChangeLine = regexp.MustCompile(`^([+~-])\s+"?([\w.\-\[\]]+)"?\s*=\s*(.+)$`)
+
+// applyProgressLine matches the "aws_instance.example: Still creating...
+// [10s elapsed]" lines apply prints while a resource operation is in
+// flight or just completed.
+var applyProgressLine = regexp.MustCompile(`^(\S+): (Creating|Destroying|Modifying|Still creating|Still destroying|Still modifying|Creation complete|Destruction complete|Modifications complete)(?:.*?\[(\d+s) elapsed\])?`)
+
+// outputLine matches a single "name = value" line inside the
+// "Outputs:" block apply and output print at the end of a run.
+var outputLine = regexp.MustCompile(`^(\w[\w-]*)\s*=\s*(.*)$`)
+
+func (u *JSONUi) Ask(query string) (string, error) {
+	return u.ask(query, false)
+}
+
+func (u *JSONUi) AskSecret(query string) (string, error) {
+	return u.ask(query, true)
+}
+
+func (u *JSONUi) ask(query string, _ bool) (string, error) {
+	u.View.Diagnostic("info", query, "", nil)
+	if u.Reader == nil {
+		return "", fmt.Errorf("interactive input is not supported in JSON output mode")
+	}
+	var line string
+	if _, err := fmt.Fscanln(bufio.NewReader(u.Reader), &line); err != nil {
+		return "", err
+	}
+	return line, nil
+}
+
+func (u *JSONUi) Output(message string) {
+	for _, line := range strings.Split(message, "\n") {
+		u.classifyLine(ansiEscape.ReplaceAllString(line, ""))
+	}
+}
+
+func (u *JSONUi) Info(message string) {
+	u.View.Diagnostic("info", message, "", nil)
+}
+
+func (u *JSONUi) Warn(message string) {
+	u.View.Diagnostic("warning", message, "", nil)
+}
+
+func (u *JSONUi) Error(message string) {
+	u.View.Diagnostic("error", message, "", nil)
+}
+
+// classifyLine classifies a single (already color-stripped) line of an
+// Output() call, emitting the richer event type it matches or falling
+// back to a plain "diagnostic" event.
+func (u *JSONUi) classifyLine(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	if trimmed == "Outputs:" {
+		u.flushOutputs()
+		u.inOutputs = true
+		u.outputs = make(map[string]interface{})
+		return
+	}
+
+	if u.inOutputs {
+		if trimmed == "" {
+			u.flushOutputs()
+			return
+		}
+		if m := outputLine.FindStringSubmatch(trimmed); m != nil {
+			u.outputs[m[1]] = strings.Trim(m[2], `"`)
+			return
+		}
+		u.flushOutputs()
+	}
+
+	if u.change != nil {
+		// Braces are counted (the "resource ... {" header, nested blocks
+		// and map values all open one) so that only the brace closing
+		// the resource's own diff body ends collection.
+		if strings.HasSuffix(trimmed, "{") {
+			u.change.depth++
+			return
+		}
+		if trimmed == "}" {
+			u.change.depth--
+			if u.change.depth <= 0 {
+				u.flushChange()
+			}
+			return
+		}
+		if m := attrChangeLine.FindStringSubmatch(trimmed); m != nil {
+			before, after := parseAttrChange(m[3])
+			if m[1] == "-" && before == nil {
+				before, after = after, nil
+			}
+			if before != nil {
+				u.change.before[m[2]] = before
+			}
+			if after != nil {
+				u.change.after[m[2]] = after
+			}
+			return
+		}
+		// Any other line (an unchanged attribute or a blank separator)
+		// is part of the same diff body; ignore it and keep collecting
+		// until the closing brace.
+		return
+	}
+
+	if m := plannedChangeLine.FindStringSubmatch(trimmed); m != nil {
+		u.flushChange()
+		u.change = &pendingChange{
+			resource: m[1],
+			action:   m[2],
+			before:   make(map[string]interface{}),
+			after:    make(map[string]interface{}),
+		}
+		return
+	}
+
+	if m := applyProgressLine.FindStringSubmatch(trimmed); m != nil {
+		resource, elapsed := m[1], m[3]
+		var d time.Duration
+		if elapsed != "" {
+			d, _ = time.ParseDuration(elapsed)
+		}
+		u.View.ApplyProgress(resource, d)
+		return
+	}
+
+	u.View.Diagnostic("info", line, "", nil)
+}
+
+// parseAttrChange splits a changed-attribute value into its before and
+// after values. An update line looks like `"old" -> "new"`; a create
+// or delete line has only one side, reported as after or before
+// respectively by the caller based on the line's +/- marker.
+func parseAttrChange(value string) (before, after interface{}) {
+	if old, updated, ok := cutArrow(value); ok {
+		return unquote(old), unquote(updated)
+	}
+	return nil, unquote(value)
+}
+
+func cutArrow(value string) (before, after string, ok bool) {
+	parts := strings.SplitN(value, "->", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `"`)
+}
+
+// flushOutputs emits the accumulated Outputs() event, if an "Outputs:"
+// block is currently being collected.
+func (u *JSONUi) flushOutputs() {
+	if !u.inOutputs {
+		return
+	}
+	u.inOutputs = false
+	if len(u.outputs) > 0 {
+		u.View.Outputs(u.outputs)
+	}
+	u.outputs = nil
+}
+
+// flushChange emits the accumulated planned_change event, if a
+// resource's diff body is currently being collected.
+func (u *JSONUi) flushChange() {
+	if u.change == nil {
+		return
+	}
+	c := u.change
+	u.change = nil
+
+	var before, after interface{}
+	if len(c.before) > 0 {
+		before = c.before
+	}
+	if len(c.after) > 0 {
+		after = c.after
+	}
+	u.View.PlannedChange(c.resource, c.action, before, after)
+}